@@ -1,29 +1,100 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo"
+	"github.com/penutty/authservice/middleware"
+	"github.com/penutty/authservice/oauth"
+	"github.com/penutty/authservice/signer"
 	"github.com/penutty/authservice/user"
-	"io/ioutil"
+	"gopkg.in/go-playground/validator.v9"
+	"math/big"
 	"net/http"
-	"reflect"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// validate holds the struct-tag validation rules (`validate:"required,email"`
+// etc.) for every *Req type in this file. A single instance is reused across
+// requests; Validate's Struct method is safe for concurrent use.
+var validate = validator.New()
+
+// bindAndValidate binds c's request body into req (JSON, form, or query,
+// whichever the request's Content-Type calls for) and checks the result
+// against req's `validate` struct tags. On failure it returns a non-nil
+// *echo.HTTPError for a 400 response, listing the offending fields, which
+// Echo's error handler writes, so callers can just propagate its return
+// value.
+func bindAndValidate(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		c.Logger().Printf("echo.Context.Bind Failed with err: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+
+	if err := validate.Struct(req); err != nil {
+		verrs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			c.Logger().Printf("validate.Struct Failed with err: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+
+		fields := make(map[string]string, len(verrs))
+		for _, fe := range verrs {
+			fields[fe.Field()] = fe.Tag()
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{"errors": fields})
+	}
+
+	return nil
+}
+
 func main() {
+	if err := initSigner(); err != nil {
+		panic(err)
+	}
+	if err := initTOTPMasterKey(); err != nil {
+		panic(err)
+	}
+	initOAuthClients()
+
 	e := echo.New()
 	e.POST("/user/:user/create", createUser)
-	e.POST("/auth", authUser)
+	e.POST("/auth", authUser, middleware.IPRateLimit(authRateLimitRPS, authRateLimitBurst))
+	e.POST("/auth/refresh", refreshAuth)
+	e.POST("/auth/logout", logout)
+	e.POST("/auth/2fa", auth2FA, middleware.IPRateLimit(authRateLimitRPS, authRateLimitBurst))
+
+	e.POST("/oauth/authorize", oauthAuthorize, middleware.IPRateLimit(authRateLimitRPS, authRateLimitBurst))
+	e.POST("/oauth/authorize/2fa", oauthAuthorizeConfirm, middleware.IPRateLimit(authRateLimitRPS, authRateLimitBurst))
+	e.POST("/oauth/token", oauthToken)
+	e.GET("/.well-known/jwks.json", jwks)
+
+	me := e.Group("/me", middleware.JWT(activeVerifier, jwtIssuer, jwtAudience))
+	me.GET("", getMe)
+	me.POST("/password", updateMePassword)
+	me.POST("/email", updateMeEmail)
+	me.DELETE("", deleteMe)
+	me.POST("/2fa/enroll", enrollMe2FA)
+	me.POST("/2fa/confirm", confirmMe2FA)
+	me.POST("/2fa/disable", disableMe2FA)
+
+	e.GET("/me/email/confirm/:token", confirmMeEmail)
 
 	e.Logger.Fatal(e.Start(":8080"))
 }
 
-// CreateUserReq represents the fields and datatypes
+// createUserReq represents the fields and datatypes
 // that are required by the createUser endpoint.
 type createUserReq struct {
-	authUserReq
-	Email string
+	UserID   string `json:"UserID" form:"UserID" validate:"required"`
+	Email    string `json:"Email" form:"Email" validate:"required,email"`
+	Password string `json:"Password" form:"Password" validate:"required,min=12,max=128"`
 }
 
 // createUser is a POST endpoint that accepts
@@ -36,23 +107,21 @@ type createUserReq struct {
 // on success returns
 // Status: 201 - Created
 func createUser(c echo.Context) error {
-	resource := reflect.ValueOf(new(createUserReq)).Elem()
-	err := validateContext(resource, c)
-	if err != nil {
-		c.Logger().Printf("main.ValidateContext Failed with err: %v", err)
-		return c.NoContent(http.StatusBadRequest)
+	req := new(createUserReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
 	}
 
 	u := &user.User{
 		AuthCredentials: user.AuthCredentials{
-			UserID:   c.FormValue("UserID"),
-			Password: c.FormValue("Password"),
+			UserID:   req.UserID,
+			Password: req.Password,
 		},
-		Email: c.FormValue("Email"),
+		Email: req.Email,
 	}
 
 	status := http.StatusCreated
-	if err = user.CreateUser(u); err != nil {
+	if err := user.CreateUser(u); err != nil {
 		c.Logger().Printf("user.CreateUser Failed with error: %v", err)
 		switch err {
 		case user.UserAlreadyExists:
@@ -65,11 +134,11 @@ func createUser(c echo.Context) error {
 	return c.NoContent(status)
 }
 
-// AuthCredentialsReq represents the fields and datatypes
+// authUserReq represents the fields and datatypes
 // that are required by the authUser endpoint
 type authUserReq struct {
-	UserID   string
-	Password string
+	UserID   string `json:"UserID" form:"UserID" validate:"required"`
+	Password string `json:"Password" form:"Password" validate:"required"`
 }
 
 // authUser is a POST endpoint that accepts
@@ -80,115 +149,833 @@ type authUserReq struct {
 // on success returns
 // Status: 200
 func authUser(c echo.Context) error {
-	resource := reflect.ValueOf(new(authUserReq)).Elem()
-	if err := validateContext(resource, c); err != nil {
-		c.Logger().Printf("main.ValidateContext Failed with err: %v", err)
-		return c.NoContent(http.StatusBadRequest)
+	req := new(authUserReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	if !authUserRateLimiter.Allow(req.UserID) {
+		c.Response().Header().Set("Retry-After", "1")
+		return c.NoContent(http.StatusTooManyRequests)
 	}
 
 	aC := &user.AuthCredentials{
-		UserID:   c.FormValue("UserID"),
-		Password: c.FormValue("Password"),
+		UserID:   req.UserID,
+		Password: req.Password,
 	}
 
-	if err := user.AuthUser(aC); err != nil {
-		c.Logger().Printf("user.AuthUser Failed with error: %v", err)
+	if err := user.Authenticate(aC); err != nil {
+		c.Logger().Printf("user.Authenticate Failed with error: %v", err)
+		if err == user.AccountLocked {
+			c.Response().Header().Set("Retry-After", formatRetryAfter(user.RetryAfter(req.UserID)))
+			return c.NoContent(http.StatusTooManyRequests)
+		}
 		return c.NoContent(http.StatusUnauthorized)
 	}
 
-	token, err := generateJwt(c.FormValue("UserID"))
+	if user.TOTPEnabled(req.UserID) {
+		mfaToken, err := generateMfaPendingJwt(req.UserID)
+		if err != nil {
+			c.Logger().Print(err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+	}
+
+	token, err := generateJwt(req.UserID)
+	if err != nil {
+		c.Logger().Print(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	refreshToken, err := user.IssueRefreshToken(req.UserID)
 	if err != nil {
 		c.Logger().Print(err)
 		return c.NoContent(http.StatusInternalServerError)
 	}
 
 	c.Response().Header().Set("jwt", token)
+	c.Response().Header().Set("refresh-token", refreshToken)
 
 	return c.NoContent(http.StatusOK)
 }
 
-var ReqLengthStructLengthNotEqual = errors.New("Number of fields in request is different than number of struct fields.")
-var ReqFieldsStructFieldsNotEqual = errors.New("Not all Request fields and resource fields are matching.")
+// mfaPendingTTL is how long a mfa_pending token returned by authUser stays
+// exchangeable at auth2FA.
+const mfaPendingTTL = 5 * time.Minute
 
-// validateRequest compares the c Context of the request to the resource type
-// that will be used to access the data.
-// If c context has the incorrect number of fields, error.
-// If c context does not have the correct fields, error.
-// On success, return nil.
-func validateContext(resource reflect.Value, c echo.Context) (err error) {
+// generateMfaPendingJwt mints a short-lived token attesting that UserID's
+// password check passed, but that 2FA is still required before a full
+// access token is issued. It carries the "mfa_required" claim that
+// middleware.JWT rejects, so it can never be mistaken for a real session.
+func generateMfaPendingJwt(UserID string) (string, error) {
+	jti, err := newJti()
+	if err != nil {
+		return "", err
+	}
 
-	fields := getResourceFields(resource, c)
+	claims := jwt.MapClaims{
+		"iss":          jwtIssuer,
+		"sub":          UserID,
+		"aud":          jwtAudience,
+		"exp":          time.Now().UTC().Add(mfaPendingTTL).Unix(),
+		"iat":          time.Now().UTC().Unix(),
+		"jti":          jti,
+		"mfa_required": true,
+	}
 
-	reqForm, err := c.FormParams()
-	if err != nil {
-		c.Logger().Printf("validateRequest Failed with error: %v", err)
+	return activeSigner.Sign(claims)
+}
+
+// mfaJtiStore tracks the "jti" of every mfa_token that has completed 2FA, so
+// a captured mfa_token can't be replayed to mint a second session: it stays
+// valid for retries against a mistyped code (mirroring oauth.ExchangeCode,
+// which only marks a code used once its PKCE check passes), but a
+// successful redemption can happen at most once.
+type mfaJtiStore struct {
+	mu       sync.Mutex
+	redeemed map[string]time.Time // jti -> expiry, so entries can be GC'd
+}
+
+var defaultMfaJtiStore = &mfaJtiStore{redeemed: make(map[string]time.Time)}
+
+// redeemMfaJti marks jti used, expiring it at exp, and reports whether it
+// was unused before this call.
+func redeemMfaJti(jti string, exp time.Time) bool {
+	defaultMfaJtiStore.mu.Lock()
+	defer defaultMfaJtiStore.mu.Unlock()
+
+	now := time.Now().UTC()
+	for j, e := range defaultMfaJtiStore.redeemed {
+		if now.After(e) {
+			delete(defaultMfaJtiStore.redeemed, j)
+		}
+	}
+
+	if e, ok := defaultMfaJtiStore.redeemed[jti]; ok && now.Before(e) {
+		return false
+	}
+	defaultMfaJtiStore.redeemed[jti] = exp
+	return true
+}
+
+// redeemMfaClaims marks the mfa_token identified by claims' "jti" as used,
+// failing if it has no jti/exp claim or has already been redeemed.
+func redeemMfaClaims(claims jwt.MapClaims) error {
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return errors.New("authservice: mfa_token missing jti claim")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("authservice: mfa_token missing exp claim")
+	}
+	if !redeemMfaJti(jti, time.Unix(int64(exp), 0).UTC()) {
+		return errors.New("authservice: mfa_token already used")
+	}
+	return nil
+}
+
+// auth2FAReq represents the fields required to complete a login that
+// authUser left pending on 2FA.
+type auth2FAReq struct {
+	MfaToken string `json:"MfaToken" form:"MfaToken" validate:"required"`
+	Code     string `json:"Code" form:"Code" validate:"required"`
+}
+
+// auth2FA is a POST endpoint that accepts
+// Body: {
+//			MfaToken: MfaToken
+//			Code: Code
+//		 }
+// MfaToken is the mfa_token authUser returned; Code is a 6-digit TOTP code
+// or one of the user's recovery codes.
+// on success returns
+// Status: 200, with the real access JWT in the "jwt" response header.
+func auth2FA(c echo.Context) error {
+	req := new(auth2FAReq)
+	if err := bindAndValidate(c, req); err != nil {
 		return err
 	}
 
-	if len(reqForm) != len(fields) {
-		c.Logger().Printf("validateRequest failed, reqForm length = %v and %v length = %v.", len(reqForm), resource.String(), len(fields))
-		return ReqLengthStructLengthNotEqual
+	claims, err := activeVerifier.Verify(req.MfaToken)
+	if err != nil {
+		c.Logger().Printf("activeVerifier.Verify Failed with error: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	if mfaRequired, _ := claims["mfa_required"].(bool); !mfaRequired {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	if !auth2FARateLimiter.Allow(userID) {
+		c.Response().Header().Set("Retry-After", "1")
+		return c.NoContent(http.StatusTooManyRequests)
 	}
 
-	for _, v := range fields {
-		if stringValue := c.FormValue(v); stringValue == "" {
-			c.Logger().Printf("Request was missing key:value pairs.")
-			return ReqFieldsStructFieldsNotEqual
+	if err := user.Validate2FA(userID, req.Code); err != nil {
+		c.Logger().Printf("user.Validate2FA Failed with error: %v", err)
+		if err == user.AccountLocked {
+			c.Response().Header().Set("Retry-After", formatRetryAfter(user.RetryAfter(userID)))
+			return c.NoContent(http.StatusTooManyRequests)
 		}
+		return c.NoContent(http.StatusUnauthorized)
 	}
 
-	return nil
+	if err := redeemMfaClaims(claims); err != nil {
+		c.Logger().Printf("redeemMfaClaims Failed with error: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	token, err := generateJwt(userID)
+	if err != nil {
+		c.Logger().Print(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	refreshToken, err := user.IssueRefreshToken(userID)
+	if err != nil {
+		c.Logger().Print(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	c.Response().Header().Set("jwt", token)
+	c.Response().Header().Set("refresh-token", refreshToken)
+
+	return c.NoContent(http.StatusOK)
+}
+
+// refreshAuthReq represents the fields required to exchange a refresh token
+// for a new access JWT.
+type refreshAuthReq struct {
+	RefreshToken string `json:"RefreshToken" form:"RefreshToken" validate:"required"`
+}
+
+// refreshAuth is a POST endpoint that accepts
+// Body: {
+//			RefreshToken: RefreshToken
+//		 }
+// on success returns
+// Status: 200, with the new access JWT in the "jwt" response header.
+func refreshAuth(c echo.Context) error {
+	req := new(refreshAuthReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	rt, err := user.RedeemRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.Logger().Printf("user.RedeemRefreshToken Failed with error: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	token, err := generateJwt(rt.UserID)
+	if err != nil {
+		c.Logger().Print(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	c.Response().Header().Set("jwt", token)
+
+	return c.NoContent(http.StatusOK)
 }
 
-var StructNotRecognized = errors.New("Arguement resource string not recognized past into getStructFields.")
+// logoutReq represents the fields required to revoke a refresh token.
+type logoutReq struct {
+	RefreshToken string `json:"RefreshToken" form:"RefreshToken" validate:"required"`
+	// AllDevices, if true, revokes every refresh token issued to the
+	// presented token's owner instead of only the presented one.
+	AllDevices bool `json:"AllDevices" form:"AllDevices"`
+}
 
-// getResourceFields returns a string slice of all fields in argument resource.
-// c Context is passed in for logging.
-func getResourceFields(resource reflect.Value, c echo.Context) (rFields []string) {
+// logout is a POST endpoint that accepts
+// Body: {
+//			RefreshToken: RefreshToken
+//			AllDevices: AllDevices
+//		 }
+// It revokes the presented refresh token so it can no longer be redeemed.
+// If AllDevices is true, it instead revokes every refresh token issued to
+// the presented token's owner.
+// on success returns
+// Status: 204
+func logout(c echo.Context) error {
+	req := new(logoutReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
 
-	for i := 0; i < resource.NumField(); i++ {
-		fieldValue := resource.Field(i)
-		fieldName := resource.Type().Field(i).Name
-		if fieldValue.Type().Kind() == reflect.Struct {
-			recFields := getResourceFields(fieldValue, c)
-			rFields = append(rFields, recFields...)
-		} else {
-			rFields = append(rFields, fieldName)
+	if !req.AllDevices {
+		if err := user.RevokeRefreshToken(req.RefreshToken); err != nil {
+			c.Logger().Printf("user.RevokeRefreshToken Failed with error: %v", err)
+			return c.NoContent(http.StatusUnauthorized)
 		}
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	rt, err := user.RedeemRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.Logger().Printf("user.RedeemRefreshToken Failed with error: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	if err := user.RevokeAllRefreshTokens(rt.UserID); err != nil {
+		c.Logger().Printf("user.RevokeAllRefreshTokens Failed with error: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
 	}
 
-	return rFields
+	return c.NoContent(http.StatusNoContent)
 }
 
-// generateJwt uses a requests UserID and a []byte secret to generate a JSON web token.
-func generateJwt(UserID string) (string, error) {
+// activeSigner and activeVerifier are configured once at startup (see
+// initSigner, called from main) from JWT_SIGNING_ALG and friends; see the
+// signer package for the supported algorithms.
+var (
+	activeSigner   signer.Signer
+	activeVerifier signer.Verifier
+)
+
+// initSigner builds activeSigner/activeVerifier from the environment. It
+// must run before any call to generateJwt or jwks.
+func initSigner() error {
+	s, v, err := signer.NewFromEnv()
+	if err != nil {
+		return err
+	}
+	activeSigner = s
+	activeVerifier = v
+	return nil
+}
+
+// initTOTPMasterKey derives the AES-256 key TOTP secrets are encrypted with
+// from TOTP_MASTER_KEY and configures it. Deriving via sha256 means the
+// operator's secret doesn't need to be exactly 32 bytes, and checking it
+// here means a misconfigured/missing secret fails fast at boot instead of
+// as an opaque 500 the first time a caller exercises 2FA.
+func initTOTPMasterKey() error {
+	secret := os.Getenv("TOTP_MASTER_KEY")
+	if secret == "" {
+		return errors.New("TOTP_MASTER_KEY is not set")
+	}
+	key := sha256.Sum256([]byte(secret))
+	user.SetTOTPMasterKey(key[:])
+	return nil
+}
+
+// initOAuthClients seeds the OAuth client registry from the environment.
+// There is no self-service client registration endpoint: registering a
+// client is an operator action, not something an end user does, so the
+// first-party client this service issues authorization codes to is
+// configured the same way the JWT signer is, from environment variables
+// read once at startup. OAUTH_CLIENT_ID/OAUTH_REDIRECT_URI are both
+// optional; if either is unset the authorization code flow simply has no
+// registered client until one is added with oauth.RegisterClient.
+func initOAuthClients() {
+	clientID := os.Getenv("OAUTH_CLIENT_ID")
+	redirectURI := os.Getenv("OAUTH_REDIRECT_URI")
+	if clientID == "" || redirectURI == "" {
+		return
+	}
+	oauth.RegisterClient(&oauth.Client{
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+	})
+}
 
-	p, err := ioutil.ReadFile("/home/tjp/.ssh/jwt_private.pem")
+// generateJwt uses a requests UserID to generate a JSON web token with the
+// algorithm and key activeSigner was configured with.
+func generateJwt(UserID string) (string, error) {
+	jti, err := newJti()
 	if err != nil {
 		return "", err
 	}
 
-	t := jwt.New(jwt.SigningMethodRS256)
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok {
+	claims := jwt.MapClaims{
+		"iss": jwtIssuer,
+		"sub": UserID,
+		"aud": jwtAudience,
+		"exp": time.Now().UTC().Add(accessTokenTTL).Unix(),
+		"iat": time.Now().UTC().Unix(),
+		"jti": jti,
+	}
+
+	return activeSigner.Sign(claims)
+}
+
+// accessTokenTTL is how long an access JWT minted by generateJwt remains
+// valid. It is kept short now that a refresh token is available to obtain a
+// new one without re-authenticating.
+const accessTokenTTL = 15 * time.Minute
+
+// jwtIssuer and jwtAudience are the "iss"/"aud" claims generateJwt sets and
+// the JWT middleware requires.
+const (
+	jwtIssuer   = "Auth-Service"
+	jwtAudience = "Moment-Service"
+)
+
+// authRateLimitRPS and authRateLimitBurst bound how often a single client IP
+// or UserID may call POST /auth, independent of the failed-attempt lockout
+// enforced by user.Authenticate.
+const (
+	authRateLimitRPS   = 1
+	authRateLimitBurst = 5
+)
+
+// authUserRateLimiter bounds how often POST /auth may be called for a given
+// UserID, so an attacker who rotates source IPs to sidestep IPRateLimit
+// can't use that to get more password guesses against a single account.
+var authUserRateLimiter = middleware.NewUserLimiter(authRateLimitRPS, authRateLimitBurst)
+
+// auth2FARateLimiter bounds how often a given UserID's 2FA completion
+// endpoints (auth2FA, oauthAuthorizeConfirm) may be called, so a holder of a
+// valid mfa_token can't brute-force the 6-digit TOTP code or a recovery code
+// without limit.
+var auth2FARateLimiter = middleware.NewUserLimiter(authRateLimitRPS, authRateLimitBurst)
+
+// formatRetryAfter renders d, rounded up to the nearest whole second, as the
+// value of a Retry-After response header.
+func formatRetryAfter(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if d%time.Second != 0 {
+		seconds++
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+// newJti returns a random, URL-safe token suitable for use as a JWT "jti"
+// claim, so a downstream deny-list can revoke individual access tokens.
+func newJti() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// jwk is the JSON representation of a single RSA public key, per RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwks is a GET endpoint that publishes the public half of the active RS256
+// signing key as a JWK Set, so downstream services can verify
+// authservice-issued JWTs without file-system access to the private key. It
+// only has a key to publish when activeSigner is RS256; other algorithms
+// either have no public half (HS256) or aren't exposed here yet.
+// Status: 200
+func jwks(c echo.Context) error {
+	rs256, ok := activeSigner.(*signer.RS256Signer)
+	if !ok {
+		return c.JSON(http.StatusOK, map[string]interface{}{"keys": []jwk{}})
+	}
+
+	pub := rs256.PublicKey()
+	n := base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"keys": []jwk{
+			{
+				Kty: "RSA",
+				Use: "sig",
+				Kid: rs256.KeyID(),
+				Alg: rs256.Alg(),
+				N:   n,
+				E:   e,
+			},
+		},
+	})
+}
+
+// oauthAuthorizeReq represents the fields required to authenticate the
+// resource owner and issue a PKCE-bound authorization code.
+type oauthAuthorizeReq struct {
+	ClientID            string `json:"ClientID" form:"ClientID" validate:"required"`
+	RedirectURI         string `json:"RedirectURI" form:"RedirectURI" validate:"required,url"`
+	CodeChallenge       string `json:"CodeChallenge" form:"CodeChallenge" validate:"required"`
+	CodeChallengeMethod string `json:"CodeChallengeMethod" form:"CodeChallengeMethod" validate:"required,eq=S256"`
+	UserID              string `json:"UserID" form:"UserID" validate:"required"`
+	Password            string `json:"Password" form:"Password" validate:"required"`
+}
+
+// oauthAuthorize is a POST endpoint that accepts
+// Body: {
+//			ClientID: ClientID
+//			RedirectURI: RedirectURI
+//			CodeChallenge: CodeChallenge
+//			CodeChallengeMethod: CodeChallengeMethod
+//			UserID: UserID
+//			Password: Password
+//		 }
+// It authenticates the resource owner the same way authUser does (lockout,
+// Argon2id migration included) and, on success, issues a short-lived
+// authorization code bound to the supplied PKCE code_challenge. If the
+// account has 2FA enabled, no code is issued yet; the caller must complete
+// oauthAuthorizeConfirm with the returned mfa_token first.
+// on success returns
+// Status: 200 - {"code": "..."} or {"mfa_required": true, "mfa_token": "..."}
+func oauthAuthorize(c echo.Context) error {
+	req := new(oauthAuthorizeReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	if !authUserRateLimiter.Allow(req.UserID) {
+		c.Response().Header().Set("Retry-After", "1")
+		return c.NoContent(http.StatusTooManyRequests)
+	}
+
+	aC := &user.AuthCredentials{
+		UserID:   req.UserID,
+		Password: req.Password,
+	}
+	if err := user.Authenticate(aC); err != nil {
+		c.Logger().Printf("user.Authenticate Failed with error: %v", err)
+		if err == user.AccountLocked {
+			c.Response().Header().Set("Retry-After", formatRetryAfter(user.RetryAfter(req.UserID)))
+			return c.NoContent(http.StatusTooManyRequests)
+		}
+		return c.NoContent(http.StatusUnauthorized)
+	}
 
-	claims["iss"] = "Auth-Service"
-	claims["sub"] = UserID
-	claims["aud"] = "Moment-Service"
-	claims["exp"] = time.Now().UTC().AddDate(0, 0, 7).Unix()
-	claims["iat"] = time.Now().UTC().Unix()
+	if user.TOTPEnabled(req.UserID) {
+		mfaToken, err := generateMfaPendingJwt(req.UserID)
+		if err != nil {
+			c.Logger().Print(err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+	}
 
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(p)
+	ac, err := oauth.CreateAuthorizationCode(
+		req.ClientID,
+		req.RedirectURI,
+		req.UserID,
+		nil,
+		req.CodeChallenge,
+		req.CodeChallengeMethod,
+	)
 	if err != nil {
-		return "", err
+		c.Logger().Printf("oauth.CreateAuthorizationCode Failed with error: %v", err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"code": ac.Code})
+}
+
+// oauthAuthorizeConfirmReq represents the fields required to complete an
+// oauthAuthorize call that was left pending on 2FA.
+type oauthAuthorizeConfirmReq struct {
+	MfaToken            string `json:"MfaToken" form:"MfaToken" validate:"required"`
+	Code                string `json:"Code" form:"Code" validate:"required"`
+	ClientID            string `json:"ClientID" form:"ClientID" validate:"required"`
+	RedirectURI         string `json:"RedirectURI" form:"RedirectURI" validate:"required,url"`
+	CodeChallenge       string `json:"CodeChallenge" form:"CodeChallenge" validate:"required"`
+	CodeChallengeMethod string `json:"CodeChallengeMethod" form:"CodeChallengeMethod" validate:"required,eq=S256"`
+}
+
+// oauthAuthorizeConfirm is a POST endpoint that accepts
+// Body: {
+//			MfaToken: MfaToken
+//			Code: Code
+//			ClientID: ClientID
+//			RedirectURI: RedirectURI
+//			CodeChallenge: CodeChallenge
+//			CodeChallengeMethod: CodeChallengeMethod
+//		 }
+// MfaToken is the mfa_token oauthAuthorize returned; Code is a 6-digit TOTP
+// code or one of the user's recovery codes. ClientID/RedirectURI/
+// CodeChallenge/CodeChallengeMethod must match the original oauthAuthorize
+// call; they are re-sent here rather than carried in the token because the
+// PKCE code_challenge is meant to be bound at exchange time, not embedded
+// in a bearer token.
+// on success returns
+// Status: 200 - {"code": "..."}
+func oauthAuthorizeConfirm(c echo.Context) error {
+	req := new(oauthAuthorizeConfirmReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
 	}
 
-	token, err := t.SignedString(key)
+	claims, err := activeVerifier.Verify(req.MfaToken)
 	if err != nil {
-		return "", err
+		c.Logger().Printf("activeVerifier.Verify Failed with error: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	if mfaRequired, _ := claims["mfa_required"].(bool); !mfaRequired {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	if !auth2FARateLimiter.Allow(userID) {
+		c.Response().Header().Set("Retry-After", "1")
+		return c.NoContent(http.StatusTooManyRequests)
+	}
+
+	if err := user.Validate2FA(userID, req.Code); err != nil {
+		c.Logger().Printf("user.Validate2FA Failed with error: %v", err)
+		if err == user.AccountLocked {
+			c.Response().Header().Set("Retry-After", formatRetryAfter(user.RetryAfter(userID)))
+			return c.NoContent(http.StatusTooManyRequests)
+		}
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	if err := redeemMfaClaims(claims); err != nil {
+		c.Logger().Printf("redeemMfaClaims Failed with error: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	ac, err := oauth.CreateAuthorizationCode(
+		req.ClientID,
+		req.RedirectURI,
+		userID,
+		nil,
+		req.CodeChallenge,
+		req.CodeChallengeMethod,
+	)
+	if err != nil {
+		c.Logger().Printf("oauth.CreateAuthorizationCode Failed with error: %v", err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"code": ac.Code})
+}
+
+// oauthTokenReq represents the fields required to exchange an authorization
+// code for a JWT.
+type oauthTokenReq struct {
+	GrantType    string `json:"GrantType" form:"GrantType" validate:"required,eq=authorization_code"`
+	Code         string `json:"Code" form:"Code" validate:"required"`
+	ClientID     string `json:"ClientID" form:"ClientID" validate:"required"`
+	RedirectURI  string `json:"RedirectURI" form:"RedirectURI" validate:"required,url"`
+	CodeVerifier string `json:"CodeVerifier" form:"CodeVerifier" validate:"required"`
+}
+
+// oauthToken is a POST endpoint that accepts
+// Body: {
+//			GrantType: "authorization_code"
+//			Code: Code
+//			ClientID: ClientID
+//			RedirectURI: RedirectURI
+//			CodeVerifier: CodeVerifier
+//		 }
+// on success returns
+// Status: 200 - {"access_token": "...", "refresh_token": "...", "token_type": "Bearer"}
+func oauthToken(c echo.Context) error {
+	req := new(oauthTokenReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	ac, err := oauth.ExchangeCode(
+		req.Code,
+		req.ClientID,
+		req.RedirectURI,
+		req.CodeVerifier,
+	)
+	if err != nil {
+		c.Logger().Printf("oauth.ExchangeCode Failed with error: %v", err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	token, err := generateJwt(ac.UserID)
+	if err != nil {
+		c.Logger().Print(err)
+		return c.NoContent(http.StatusInternalServerError)
 	}
 
-	return token, nil
+	refreshToken, err := user.IssueRefreshToken(ac.UserID)
+	if err != nil {
+		c.Logger().Print(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"access_token":  token,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+	})
+}
+
+// getMe is a GET endpoint, protected by middleware.JWT, that returns the
+// caller's own profile.
+// on success returns
+// Status: 200
+func getMe(c echo.Context) error {
+	u, err := user.GetUser(middleware.UserID(c))
+	if err != nil {
+		c.Logger().Printf("user.GetUser Failed with error: %v", err)
+		return c.NoContent(http.StatusNotFound)
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"UserID": u.UserID,
+		"Email":  u.Email,
+	})
+}
+
+// updateMePasswordReq represents the fields required to change the caller's
+// password.
+type updateMePasswordReq struct {
+	CurrentPassword string `json:"CurrentPassword" form:"CurrentPassword" validate:"required"`
+	NewPassword     string `json:"NewPassword" form:"NewPassword" validate:"required,min=12,max=128"`
+}
+
+// updateMePassword is a POST endpoint, protected by middleware.JWT, that
+// accepts
+// Body: {
+//			CurrentPassword: CurrentPassword
+//			NewPassword: NewPassword
+//		 }
+// on success returns
+// Status: 204
+func updateMePassword(c echo.Context) error {
+	req := new(updateMePasswordReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	err := user.UpdatePassword(middleware.UserID(c), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		c.Logger().Printf("user.UpdatePassword Failed with error: %v", err)
+		switch err {
+		case user.IncorrectPassword:
+			return c.NoContent(http.StatusUnauthorized)
+		default:
+			return c.NoContent(http.StatusInternalServerError)
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// updateMeEmailReq represents the fields required to start an email change
+// for the caller.
+type updateMeEmailReq struct {
+	NewEmail string `json:"NewEmail" form:"NewEmail" validate:"required,email"`
+}
+
+// updateMeEmail is a POST endpoint, protected by middleware.JWT, that
+// accepts
+// Body: {
+//			NewEmail: NewEmail
+//		 }
+// It does not change the account's email of record immediately; the new
+// address takes effect once confirmMeEmail is called with the returned
+// verification token.
+// on success returns
+// Status: 202
+func updateMeEmail(c echo.Context) error {
+	req := new(updateMeEmailReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	token, err := user.UpdateEmail(middleware.UserID(c), req.NewEmail)
+	if err != nil {
+		c.Logger().Printf("user.UpdateEmail Failed with error: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{"verification_token": token})
+}
+
+// confirmMeEmail is a GET endpoint that applies an email change previously
+// started by updateMeEmail, identified by the :token path parameter a
+// verification mail would have carried.
+// on success returns
+// Status: 204
+func confirmMeEmail(c echo.Context) error {
+	if err := user.ConfirmEmailChange(c.Param("token")); err != nil {
+		c.Logger().Printf("user.ConfirmEmailChange Failed with error: %v", err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// enrollMe2FA is a POST endpoint, protected by middleware.JWT, that begins
+// TOTP enrollment for the caller.
+// on success returns
+// Status: 200 - {"secret": "...", "otpauth_uri": "..."}
+func enrollMe2FA(c echo.Context) error {
+	secret, otpauthURI, err := user.EnrollTOTP(middleware.UserID(c))
+	if err != nil {
+		c.Logger().Printf("user.EnrollTOTP Failed with error: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": otpauthURI,
+	})
+}
+
+// confirmMe2FAReq represents the fields required to confirm a pending TOTP
+// enrollment.
+type confirmMe2FAReq struct {
+	Code string `json:"Code" form:"Code" validate:"required,len=6,numeric"`
+}
+
+// confirmMe2FA is a POST endpoint, protected by middleware.JWT, that
+// accepts
+// Body: {
+//			Code: Code
+//		 }
+// On a valid code, 2FA is enabled for the caller and ten recovery codes are
+// returned; they are shown exactly once.
+// on success returns
+// Status: 200 - {"recovery_codes": ["...", ...]}
+func confirmMe2FA(c echo.Context) error {
+	req := new(confirmMe2FAReq)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+
+	recoveryCodes, err := user.ConfirmTOTP(middleware.UserID(c), req.Code)
+	if err != nil {
+		c.Logger().Printf("user.ConfirmTOTP Failed with error: %v", err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]string{"recovery_codes": recoveryCodes})
+}
+
+// disableMe2FA is a POST endpoint, protected by middleware.JWT, that turns
+// off 2FA for the caller.
+// on success returns
+// Status: 204
+func disableMe2FA(c echo.Context) error {
+	if err := user.DisableTOTP(middleware.UserID(c)); err != nil {
+		c.Logger().Printf("user.DisableTOTP Failed with error: %v", err)
+		return c.NoContent(http.StatusBadRequest)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// deleteMe is a DELETE endpoint, protected by middleware.JWT, that deletes
+// the caller's own account.
+// on success returns
+// Status: 204
+func deleteMe(c echo.Context) error {
+	if err := user.DeleteUser(middleware.UserID(c)); err != nil {
+		c.Logger().Printf("user.DeleteUser Failed with error: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
 }
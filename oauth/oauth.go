@@ -0,0 +1,167 @@
+// Package oauth implements the pieces of OAuth 2.0 / OpenID Connect that
+// authservice needs to act as an authorization server: client registration,
+// PKCE-bound authorization codes, and the authorization-code-for-token
+// exchange. Issued tokens are still minted by the caller (see main.generateJwt);
+// this package is only responsible for the authorization-code bookkeeping.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Client represents a registered third-party application that is allowed to
+// drive the authorization code flow.
+type Client struct {
+	ClientID     string
+	RedirectURI  string
+	AllowedScope []string
+}
+
+// AuthorizationCode is a short-lived, single-use code bound to a PKCE
+// challenge. It is exchanged for a token at the token endpoint.
+type AuthorizationCode struct {
+	Code                string
+	ClientID            string
+	RedirectURI         string
+	UserID              string
+	Scope               []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ExpiresAt           time.Time
+	used                bool
+}
+
+// codeTTL is how long an authorization code remains exchangeable.
+const codeTTL = 2 * time.Minute
+
+var (
+	// ClientNotFound is returned when a client_id has not been registered.
+	ClientNotFound = errors.New("oauth: client not found")
+	// RedirectURIMismatch is returned when the supplied redirect_uri does not
+	// match the one the client registered.
+	RedirectURIMismatch = errors.New("oauth: redirect_uri does not match registration")
+	// CodeNotFound is returned when a code is unknown, already used, or expired.
+	CodeNotFound = errors.New("oauth: authorization code not found or expired")
+	// PKCEVerificationFailed is returned when the code_verifier does not match
+	// the code_challenge recorded at authorization time.
+	PKCEVerificationFailed = errors.New("oauth: code_verifier does not match code_challenge")
+	// UnsupportedCodeChallengeMethod is returned for anything but S256.
+	UnsupportedCodeChallengeMethod = errors.New("oauth: only the S256 code_challenge_method is supported")
+)
+
+// store is a process-local registry of clients and outstanding authorization
+// codes. It is intentionally simple (in-memory, mutex-guarded) to mirror the
+// rest of authservice's lack of an external datastore abstraction.
+type store struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+	codes   map[string]*AuthorizationCode
+}
+
+var defaultStore = &store{
+	clients: make(map[string]*Client),
+	codes:   make(map[string]*AuthorizationCode),
+}
+
+// RegisterClient adds a client application to the registry. Re-registering an
+// existing ClientID overwrites its configuration.
+func RegisterClient(c *Client) {
+	defaultStore.mu.Lock()
+	defer defaultStore.mu.Unlock()
+	defaultStore.clients[c.ClientID] = c
+}
+
+// GetClient looks up a previously registered client.
+func GetClient(clientID string) (*Client, error) {
+	defaultStore.mu.Lock()
+	defer defaultStore.mu.Unlock()
+	c, ok := defaultStore.clients[clientID]
+	if !ok {
+		return nil, ClientNotFound
+	}
+	return c, nil
+}
+
+// CreateAuthorizationCode validates the client/redirect pair and mints a new
+// PKCE-bound authorization code for userID.
+func CreateAuthorizationCode(clientID, redirectURI, userID string, scope []string, codeChallenge, codeChallengeMethod string) (*AuthorizationCode, error) {
+	if codeChallengeMethod != "S256" {
+		return nil, UnsupportedCodeChallengeMethod
+	}
+
+	c, err := GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if c.RedirectURI != redirectURI {
+		return nil, RedirectURIMismatch
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := &AuthorizationCode{
+		Code:                code,
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		UserID:              userID,
+		Scope:               scope,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		ExpiresAt:           time.Now().UTC().Add(codeTTL),
+	}
+
+	defaultStore.mu.Lock()
+	defaultStore.codes[code] = ac
+	defaultStore.mu.Unlock()
+
+	return ac, nil
+}
+
+// ExchangeCode consumes a single-use authorization code, verifying the PKCE
+// code_verifier and the client/redirect pair it was issued to. On success the
+// code is marked used and cannot be exchanged again.
+func ExchangeCode(code, clientID, redirectURI, codeVerifier string) (*AuthorizationCode, error) {
+	defaultStore.mu.Lock()
+	defer defaultStore.mu.Unlock()
+
+	ac, ok := defaultStore.codes[code]
+	if !ok || ac.used || time.Now().UTC().After(ac.ExpiresAt) {
+		return nil, CodeNotFound
+	}
+	if ac.ClientID != clientID || ac.RedirectURI != redirectURI {
+		return nil, CodeNotFound
+	}
+
+	if !verifyPKCE(ac.CodeChallenge, codeVerifier) {
+		return nil, PKCEVerificationFailed
+	}
+
+	ac.used = true
+	return ac, nil
+}
+
+// verifyPKCE recomputes the S256 code_challenge from codeVerifier and
+// compares it against challenge in constant time.
+func verifyPKCE(challenge, codeVerifier string) bool {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// randomToken returns a URL-safe base64 encoding of n random bytes.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
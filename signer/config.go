@@ -0,0 +1,61 @@
+package signer
+
+import (
+	"errors"
+	"os"
+)
+
+// Environment variables that select and configure the signing algorithm.
+const (
+	envAlg          = "JWT_SIGNING_ALG"
+	envKeyID        = "JWT_KID"
+	envRSAKeyPath   = "JWT_RSA_PRIVATE_KEY_PATH"
+	envEdKeyPath    = "JWT_ED25519_PRIVATE_KEY_PATH"
+	envSharedSecret = "JWT_SHARED_SECRET"
+)
+
+// Recognized values for JWT_SIGNING_ALG.
+const (
+	AlgRS256 = "RS256"
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	defaultRSAKeyPath = "/home/tjp/.ssh/jwt_private.pem"
+	defaultKeyID      = "default"
+)
+
+// UnsupportedAlgorithm is returned when JWT_SIGNING_ALG is set to a value
+// none of the concrete Signers handle.
+var UnsupportedAlgorithm = errors.New("signer: unsupported JWT_SIGNING_ALG")
+
+// NewFromEnv builds a Signer/Verifier pair from the process environment.
+// JWT_SIGNING_ALG selects the algorithm, defaulting to RS256 to match
+// authservice's historical behavior; JWT_KID sets the "kid" the Signer
+// embeds in each token's header.
+func NewFromEnv() (Signer, Verifier, error) {
+	alg := os.Getenv(envAlg)
+	if alg == "" {
+		alg = AlgRS256
+	}
+	kid := os.Getenv(envKeyID)
+	if kid == "" {
+		kid = defaultKeyID
+	}
+
+	switch alg {
+	case AlgRS256:
+		path := os.Getenv(envRSAKeyPath)
+		if path == "" {
+			path = defaultRSAKeyPath
+		}
+		return NewRS256(path, kid)
+	case AlgHS256:
+		return NewHS256([]byte(os.Getenv(envSharedSecret)), kid)
+	case AlgEdDSA:
+		return NewEdDSA(os.Getenv(envEdKeyPath), kid)
+	default:
+		return nil, nil, UnsupportedAlgorithm
+	}
+}
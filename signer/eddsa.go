@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// EdDSASigner signs claims with an Ed25519 private key. dgrijalva/jwt-go
+// (the library the rest of authservice uses) has no EdDSA signing method,
+// so this implementation encodes and signs the compact JWT by hand rather
+// than pulling in a second JWT library.
+type EdDSASigner struct {
+	key ed25519.PrivateKey
+	kid string
+}
+
+// EdDSAVerifier validates EdDSA-signed tokens against an Ed25519 public key.
+type EdDSAVerifier struct {
+	pub ed25519.PublicKey
+}
+
+// NewEdDSA reads a raw 64-byte Ed25519 private key from path and returns a
+// matching Signer/Verifier pair, tagging tokens with kid.
+func NewEdDSA(path, kid string) (Signer, Verifier, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) != ed25519.PrivateKeySize {
+		return nil, nil, errors.New("signer: Ed25519 private key must be 64 raw bytes")
+	}
+	key := ed25519.PrivateKey(raw)
+	pub := key.Public().(ed25519.PublicKey)
+	return &EdDSASigner{key: key, kid: kid}, &EdDSAVerifier{pub: pub}, nil
+}
+
+// eddsaHeader mirrors jwt.Header's shape for the fields we need.
+type eddsaHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Sign implements Signer.
+func (s *EdDSASigner) Sign(claims jwt.MapClaims) (string, error) {
+	header := eddsaHeader{Alg: "EdDSA", Typ: "JWT", Kid: s.kid}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	sig := ed25519.Sign(s.key, []byte(signingInput))
+
+	return signingInput + "." + encodeSegment(sig), nil
+}
+
+// KeyID implements Signer.
+func (s *EdDSASigner) KeyID() string { return s.kid }
+
+// Alg implements Signer.
+func (s *EdDSASigner) Alg() string { return AlgEdDSA }
+
+// Verify implements Verifier.
+func (v *EdDSAVerifier) Verify(tokenString string) (jwt.MapClaims, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("signer: malformed token")
+	}
+
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(v.pub, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, errors.New("signer: signature verification failed")
+	}
+
+	claimsJSON, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims jwt.MapClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, err
+	}
+
+	// dgrijalva/jwt-go's Parse rejects an expired token via Claims.Valid();
+	// since this path signs and verifies by hand, it has to enforce exp
+	// itself or an EdDSA token would be valid forever.
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("signer: missing exp claim")
+	}
+	if time.Now().UTC().After(time.Unix(int64(exp), 0).UTC()) {
+		return nil, errors.New("signer: token expired")
+	}
+
+	return claims, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
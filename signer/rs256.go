@@ -0,0 +1,70 @@
+package signer
+
+import (
+	"crypto/rsa"
+	"errors"
+	"io/ioutil"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// RS256Signer signs claims with an RSA private key, the scheme authservice
+// has always used for generateJwt.
+type RS256Signer struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// RS256Verifier validates RS256-signed tokens against an RSA public key.
+type RS256Verifier struct {
+	pub *rsa.PublicKey
+}
+
+// NewRS256 reads and parses the PEM-encoded RSA private key at path and
+// returns a matching Signer/Verifier pair, tagging tokens with kid.
+func NewRS256(path, kid string) (Signer, Verifier, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &RS256Signer{key: key, kid: kid}, &RS256Verifier{pub: &key.PublicKey}, nil
+}
+
+// Sign implements Signer.
+func (s *RS256Signer) Sign(claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = s.kid
+	return t.SignedString(s.key)
+}
+
+// KeyID implements Signer.
+func (s *RS256Signer) KeyID() string { return s.kid }
+
+// Alg implements Signer.
+func (s *RS256Signer) Alg() string { return AlgRS256 }
+
+// PublicKey exposes the RSA public key so callers, e.g. a JWKS endpoint, can
+// publish it without re-reading the private key's PEM file.
+func (s *RS256Signer) PublicKey() *rsa.PublicKey { return &s.key.PublicKey }
+
+// Verify implements Verifier.
+func (v *RS256Verifier) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("signer: unexpected signing method")
+		}
+		return v.pub, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("signer: invalid token")
+	}
+	return claims, nil
+}
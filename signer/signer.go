@@ -0,0 +1,25 @@
+// Package signer abstracts JWT signing and verification behind a single
+// interface so the algorithm authservice issues tokens with (RS256, HS256,
+// or EdDSA) is a matter of configuration rather than a hard-coded call to
+// jwt.SigningMethodRS256.
+package signer
+
+import (
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Signer signs a set of claims into a compact, encoded JWT string.
+type Signer interface {
+	Sign(claims jwt.MapClaims) (string, error)
+	// KeyID is embedded in the JWT header as "kid" so a Verifier can select
+	// the right key when multiple are in rotation.
+	KeyID() string
+	// Alg is the JWT "alg" this Signer produces, e.g. "RS256".
+	Alg() string
+}
+
+// Verifier parses and validates a JWT string produced by a Signer,
+// returning its claims.
+type Verifier interface {
+	Verify(tokenString string) (jwt.MapClaims, error)
+}
@@ -0,0 +1,162 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestHS256SignAndVerify(t *testing.T) {
+	s, v, err := NewHS256([]byte("super-secret-value"), "kid-1")
+	if err != nil {
+		t.Fatalf("NewHS256 returned err: %v", err)
+	}
+
+	token, err := s.Sign(jwt.MapClaims{"sub": "user-1"})
+	if err != nil {
+		t.Fatalf("Sign returned err: %v", err)
+	}
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify returned err: %v", err)
+	}
+	if claims["sub"] != "user-1" {
+		t.Errorf("claims[sub] = %v, want user-1", claims["sub"])
+	}
+}
+
+func TestHS256MissingSecret(t *testing.T) {
+	if _, _, err := NewHS256(nil, "kid-1"); err != MissingSharedSecret {
+		t.Errorf("NewHS256 with empty secret returned err: %v, want %v", err, MissingSharedSecret)
+	}
+}
+
+func TestEdDSASignAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned err: %v", err)
+	}
+	_ = pub
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ed25519.key")
+	if err := ioutil.WriteFile(path, priv, 0600); err != nil {
+		t.Fatalf("WriteFile returned err: %v", err)
+	}
+
+	s, v, err := NewEdDSA(path, "kid-2")
+	if err != nil {
+		t.Fatalf("NewEdDSA returned err: %v", err)
+	}
+
+	token, err := s.Sign(jwt.MapClaims{"sub": "user-2", "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Sign returned err: %v", err)
+	}
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify returned err: %v", err)
+	}
+	if claims["sub"] != "user-2" {
+		t.Errorf("claims[sub] = %v, want user-2", claims["sub"])
+	}
+}
+
+func TestEdDSAVerifyRejectsExpired(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned err: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ed25519.key")
+	if err := ioutil.WriteFile(path, priv, 0600); err != nil {
+		t.Fatalf("WriteFile returned err: %v", err)
+	}
+
+	s, v, err := NewEdDSA(path, "kid-2")
+	if err != nil {
+		t.Fatalf("NewEdDSA returned err: %v", err)
+	}
+
+	token, err := s.Sign(jwt.MapClaims{"sub": "user-2", "exp": time.Now().Add(-time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Sign returned err: %v", err)
+	}
+
+	if _, err := v.Verify(token); err == nil {
+		t.Error("Verify returned nil err for an expired token, want an error")
+	}
+}
+
+func TestEdDSAVerifyRejectsMissingExp(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey returned err: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ed25519.key")
+	if err := ioutil.WriteFile(path, priv, 0600); err != nil {
+		t.Fatalf("WriteFile returned err: %v", err)
+	}
+
+	s, v, err := NewEdDSA(path, "kid-2")
+	if err != nil {
+		t.Fatalf("NewEdDSA returned err: %v", err)
+	}
+
+	token, err := s.Sign(jwt.MapClaims{"sub": "user-2"})
+	if err != nil {
+		t.Fatalf("Sign returned err: %v", err)
+	}
+
+	if _, err := v.Verify(token); err == nil {
+		t.Error("Verify returned nil err for a token missing exp, want an error")
+	}
+}
+
+func TestRS256SignAndVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned err: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rsa.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := ioutil.WriteFile(path, pemBytes, 0600); err != nil {
+		t.Fatalf("WriteFile returned err: %v", err)
+	}
+
+	s, v, err := NewRS256(path, "kid-3")
+	if err != nil {
+		t.Fatalf("NewRS256 returned err: %v", err)
+	}
+
+	token, err := s.Sign(jwt.MapClaims{"sub": "user-3"})
+	if err != nil {
+		t.Fatalf("Sign returned err: %v", err)
+	}
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify returned err: %v", err)
+	}
+	if claims["sub"] != "user-3" {
+		t.Errorf("claims[sub] = %v, want user-3", claims["sub"])
+	}
+}
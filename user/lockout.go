@@ -0,0 +1,157 @@
+package user
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// AccountLocked is returned by Authenticate when userID has accumulated more
+// than maxFailedAttempts consecutive failures and is still within its
+// lockout window.
+var AccountLocked = errors.New("user: account locked due to too many failed attempts")
+
+// AuthFailed is returned by Authenticate when the presented password does
+// not match, whether against a migrated Argon2id hash or via AuthUser's
+// legacy check.
+var AuthFailed = errors.New("user: authentication failed")
+
+const (
+	// maxFailedAttempts is how many consecutive failures are tolerated
+	// before an account is locked.
+	maxFailedAttempts = 5
+	// lockoutBase is the lockout duration applied on the first lockout; it
+	// doubles with each subsequent failure past maxFailedAttempts, up to
+	// maxLockout.
+	lockoutBase = 30 * time.Second
+	maxLockout  = 1 * time.Hour
+)
+
+// lockoutState is the per-user failed-attempt bookkeeping Authenticate
+// reads and updates.
+type lockoutState struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+type lockoutStore struct {
+	mu     sync.Mutex
+	states map[string]*lockoutState
+}
+
+var defaultLockoutStore = &lockoutStore{states: make(map[string]*lockoutState)}
+
+// Authenticate is AuthUser hardened with progressive account lockout and
+// transparent Argon2id migration: it refuses to even attempt a password
+// check while userID is locked out, verifies against an Argon2id hash from
+// a prior migration if one exists, and otherwise falls back to AuthUser's
+// legacy check and rehashes on success so the account migrates without a
+// forced reset.
+func Authenticate(ac *AuthCredentials) error {
+	if locked(ac.UserID) {
+		return AccountLocked
+	}
+
+	if hash, ok := migratedHash(ac.UserID); ok {
+		valid, err := VerifyPassword(ac.Password, hash)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			recordFailedAttempt(ac.UserID)
+			return AuthFailed
+		}
+		resetFailedAttempts(ac.UserID)
+		return nil
+	}
+
+	if err := AuthUser(ac); err != nil {
+		recordFailedAttempt(ac.UserID)
+		return err
+	}
+
+	if hash, err := HashPassword(ac.Password); err == nil {
+		setMigratedHash(ac.UserID, hash)
+	}
+
+	resetFailedAttempts(ac.UserID)
+	return nil
+}
+
+// Validate2FA checks code against userID's TOTP/recovery credentials,
+// applying the same progressive lockout Authenticate enforces for
+// passwords, so an attacker who already has a valid password can't
+// brute-force the 6-digit TOTP code (or recovery codes) without limit
+// either. A failed password check and a failed 2FA check share the same
+// lockout state: both represent a failed attempt to fully log in as
+// userID.
+func Validate2FA(userID, code string) error {
+	if locked(userID) {
+		return AccountLocked
+	}
+
+	if err := ValidateTOTPOrRecoveryCode(userID, code); err != nil {
+		recordFailedAttempt(userID)
+		return err
+	}
+
+	resetFailedAttempts(userID)
+	return nil
+}
+
+// RetryAfter returns how long the caller should wait before userID's
+// lockout clears, for use in a Retry-After response header. It is zero if
+// the account is not currently locked.
+func RetryAfter(userID string) time.Duration {
+	defaultLockoutStore.mu.Lock()
+	defer defaultLockoutStore.mu.Unlock()
+
+	s, ok := defaultLockoutStore.states[userID]
+	if !ok {
+		return 0
+	}
+	d := s.lockedUntil.Sub(time.Now().UTC())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func locked(userID string) bool {
+	defaultLockoutStore.mu.Lock()
+	defer defaultLockoutStore.mu.Unlock()
+
+	s, ok := defaultLockoutStore.states[userID]
+	return ok && time.Now().UTC().Before(s.lockedUntil)
+}
+
+// recordFailedAttempt increments userID's consecutive-failure counter and,
+// once it crosses maxFailedAttempts, (re)locks the account for an
+// exponentially increasing duration capped at maxLockout.
+func recordFailedAttempt(userID string) {
+	defaultLockoutStore.mu.Lock()
+	defer defaultLockoutStore.mu.Unlock()
+
+	s, ok := defaultLockoutStore.states[userID]
+	if !ok {
+		s = &lockoutState{}
+		defaultLockoutStore.states[userID] = s
+	}
+	s.failures++
+
+	if s.failures > maxFailedAttempts {
+		backoff := lockoutBase << uint(s.failures-maxFailedAttempts-1)
+		if backoff <= 0 || backoff > maxLockout {
+			backoff = maxLockout
+		}
+		s.lockedUntil = time.Now().UTC().Add(backoff)
+	}
+}
+
+// resetFailedAttempts clears userID's failure counter, called after a
+// successful authentication.
+func resetFailedAttempts(userID string) {
+	defaultLockoutStore.mu.Lock()
+	defer defaultLockoutStore.mu.Unlock()
+	delete(defaultLockoutStore.states, userID)
+}
@@ -0,0 +1,46 @@
+package user
+
+import "testing"
+
+func TestHashPasswordVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("HashPassword returned error: %v", err)
+	}
+	if !IsArgon2idHash(hash) {
+		t.Fatalf("HashPassword produced a hash IsArgon2idHash doesn't recognize: %s", hash)
+	}
+
+	ok, err := VerifyPassword("correct-horse-battery-staple", hash)
+	if err != nil {
+		t.Fatalf("VerifyPassword returned error: %v", err)
+	}
+	if !ok {
+		t.Fatal("VerifyPassword rejected the password it was hashed from")
+	}
+
+	ok, err = VerifyPassword("wrong-password", hash)
+	if err != nil {
+		t.Fatalf("VerifyPassword returned error: %v", err)
+	}
+	if ok {
+		t.Fatal("VerifyPassword accepted an incorrect password")
+	}
+}
+
+func TestParseArgon2idRejectsMalformed(t *testing.T) {
+	if _, err := VerifyPassword("anything", "not-an-argon2id-hash"); err == nil {
+		t.Fatal("VerifyPassword accepted a malformed hash")
+	}
+}
+
+// BenchmarkHashPassword times the package's default Argon2id parameters so
+// operators can tune ARGON2_MEMORY_KIB/ARGON2_ITERATIONS/ARGON2_PARALLELISM
+// to the latency their hardware can afford.
+func BenchmarkHashPassword(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := HashPassword("correct-horse-battery-staple"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package user
+
+import (
+	"errors"
+)
+
+// UserNotFound is returned when no user exists for a given UserID.
+var UserNotFound = errors.New("user: not found")
+
+// IncorrectPassword is returned by UpdatePassword when currentPassword does
+// not match the account's stored credentials.
+var IncorrectPassword = errors.New("user: incorrect password")
+
+// GetUser returns the profile for userID, for use by the authenticated
+// GET /me endpoint.
+func GetUser(userID string) (*User, error) {
+	u, err := lookupUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UpdatePassword changes userID's password after verifying currentPassword
+// against the account's stored credentials. newPassword is hashed and
+// stored as the account's canonical Argon2id credential; the legacy
+// password field is cleared so it can't be used as a stale fallback.
+func UpdatePassword(userID, currentPassword, newPassword string) error {
+	u, err := lookupUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := Authenticate(&AuthCredentials{UserID: u.UserID, Password: currentPassword}); err != nil {
+		return IncorrectPassword
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := setPassword(userID, ""); err != nil {
+		return err
+	}
+
+	setMigratedHash(userID, hash)
+	return nil
+}
+
+// UpdateEmail begins an email change for userID: the new address is not
+// applied until ConfirmEmailChange is called with the token this returns,
+// so the caller can mail it to the new address before the account's email
+// of record moves.
+func UpdateEmail(userID, newEmail string) (verificationToken string, err error) {
+	if _, err := lookupUser(userID); err != nil {
+		return "", err
+	}
+	return issueEmailVerification(userID, newEmail)
+}
+
+// ConfirmEmailChange applies a pending email change previously started by
+// UpdateEmail, if verificationToken is valid and unexpired.
+func ConfirmEmailChange(verificationToken string) error {
+	userID, newEmail, err := redeemEmailVerification(verificationToken)
+	if err != nil {
+		return err
+	}
+	return setEmail(userID, newEmail)
+}
+
+// DeleteUser permanently removes userID's account and revokes any
+// outstanding refresh tokens for it.
+func DeleteUser(userID string) error {
+	if err := removeUser(userID); err != nil {
+		return err
+	}
+	return RevokeAllRefreshTokens(userID)
+}
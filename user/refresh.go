@@ -0,0 +1,137 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// RefreshToken is an opaque, long-lived credential a client exchanges for a
+// new short-lived access JWT via POST /auth/refresh. Only its hash is kept
+// at rest; the plaintext value is returned to the caller exactly once, at
+// issuance.
+type RefreshToken struct {
+	UserID    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	tokenHash string
+}
+
+// refreshTokenTTL is how long an issued refresh token remains usable.
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+// RefreshTokenNotFound is returned when a presented refresh token does not
+// match any issued token.
+var RefreshTokenNotFound = errors.New("user: refresh token not found")
+
+// RefreshTokenRevoked is returned when a presented refresh token has already
+// been revoked.
+var RefreshTokenRevoked = errors.New("user: refresh token has been revoked")
+
+// RefreshTokenExpired is returned when a presented refresh token is past its
+// ExpiresAt.
+var RefreshTokenExpired = errors.New("user: refresh token has expired")
+
+// refreshStore is the in-memory, mutex-guarded refresh token store. It keys
+// entries by the sha256 hash of the plaintext token so the plaintext is
+// never retained.
+type refreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]*RefreshToken
+}
+
+var defaultRefreshStore = &refreshStore{
+	tokens: make(map[string]*RefreshToken),
+}
+
+// IssueRefreshToken mints a new opaque, 256-bit refresh token for userID and
+// records it in the store. The plaintext token is returned to the caller and
+// is not recoverable afterward; only its hash is retained.
+func IssueRefreshToken(userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(b)
+
+	rt := &RefreshToken{
+		UserID:    userID,
+		IssuedAt:  time.Now().UTC(),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		tokenHash: hashToken(plaintext),
+	}
+
+	defaultRefreshStore.mu.Lock()
+	defaultRefreshStore.tokens[rt.tokenHash] = rt
+	defaultRefreshStore.mu.Unlock()
+
+	return plaintext, nil
+}
+
+// RedeemRefreshToken validates a presented plaintext refresh token and
+// returns the RefreshToken record if it is unexpired and unrevoked.
+func RedeemRefreshToken(plaintext string) (*RefreshToken, error) {
+	hash := hashToken(plaintext)
+
+	defaultRefreshStore.mu.Lock()
+	defer defaultRefreshStore.mu.Unlock()
+
+	rt, ok := defaultRefreshStore.tokens[hash]
+	if !ok {
+		return nil, RefreshTokenNotFound
+	}
+	if rt.RevokedAt != nil {
+		return nil, RefreshTokenRevoked
+	}
+	if time.Now().UTC().After(rt.ExpiresAt) {
+		return nil, RefreshTokenExpired
+	}
+
+	return rt, nil
+}
+
+// RevokeRefreshToken revokes a single refresh token, identified by its
+// plaintext value, so it can no longer be redeemed.
+func RevokeRefreshToken(plaintext string) error {
+	hash := hashToken(plaintext)
+
+	defaultRefreshStore.mu.Lock()
+	defer defaultRefreshStore.mu.Unlock()
+
+	rt, ok := defaultRefreshStore.tokens[hash]
+	if !ok {
+		return RefreshTokenNotFound
+	}
+	if rt.RevokedAt == nil {
+		now := time.Now().UTC()
+		rt.RevokedAt = &now
+	}
+	return nil
+}
+
+// RevokeAllRefreshTokens revokes every outstanding refresh token belonging to
+// userID, e.g. on a "log out everywhere" request.
+func RevokeAllRefreshTokens(userID string) error {
+	defaultRefreshStore.mu.Lock()
+	defer defaultRefreshStore.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, rt := range defaultRefreshStore.tokens {
+		if rt.UserID == userID && rt.RevokedAt == nil {
+			rt.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// hashToken returns the hex-encoded sha256 digest of a plaintext token, used
+// as the at-rest representation and the store's lookup key.
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
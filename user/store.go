@@ -0,0 +1,149 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// profileStore backs the profile-management helpers in profile.go
+// (GetUser/UpdatePassword/UpdateEmail/DeleteUser) and the pending email
+// verification tokens they issue.
+type profileStore struct {
+	mu                 sync.Mutex
+	users              map[string]*User
+	emailVerifications map[string]*emailVerification
+	migratedHashes     map[string]string
+}
+
+type emailVerification struct {
+	UserID    string
+	NewEmail  string
+	ExpiresAt time.Time
+}
+
+const emailVerificationTTL = 24 * time.Hour
+
+var defaultProfileStore = &profileStore{
+	users:              make(map[string]*User),
+	emailVerifications: make(map[string]*emailVerification),
+	migratedHashes:     make(map[string]string),
+}
+
+// insertUser records u in the profile store, keyed by its UserID. It fails
+// with UserAlreadyExists if that UserID is already taken.
+func insertUser(u *User) error {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	if _, ok := defaultProfileStore.users[u.UserID]; ok {
+		return UserAlreadyExists
+	}
+	defaultProfileStore.users[u.UserID] = u
+	return nil
+}
+
+// lookupUser returns the stored profile for userID.
+func lookupUser(userID string) (*User, error) {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	u, ok := defaultProfileStore.users[userID]
+	if !ok {
+		return nil, UserNotFound
+	}
+	return u, nil
+}
+
+// setPassword overwrites the stored password for userID.
+func setPassword(userID, newPassword string) error {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	u, ok := defaultProfileStore.users[userID]
+	if !ok {
+		return UserNotFound
+	}
+	u.Password = newPassword
+	return nil
+}
+
+// setEmail overwrites the stored email for userID.
+func setEmail(userID, newEmail string) error {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	u, ok := defaultProfileStore.users[userID]
+	if !ok {
+		return UserNotFound
+	}
+	u.Email = newEmail
+	return nil
+}
+
+// removeUser deletes userID's stored profile and its Argon2id hash.
+func removeUser(userID string) error {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	if _, ok := defaultProfileStore.users[userID]; !ok {
+		return UserNotFound
+	}
+	delete(defaultProfileStore.users, userID)
+	delete(defaultProfileStore.migratedHashes, userID)
+	return nil
+}
+
+// migratedHash returns the Argon2id hash userID was rehashed to on a prior
+// successful login against a legacy credential, if any.
+func migratedHash(userID string) (string, bool) {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	h, ok := defaultProfileStore.migratedHashes[userID]
+	return h, ok
+}
+
+// setMigratedHash records the Argon2id hash userID has migrated to.
+func setMigratedHash(userID, hash string) {
+	defaultProfileStore.mu.Lock()
+	defaultProfileStore.migratedHashes[userID] = hash
+	defaultProfileStore.mu.Unlock()
+}
+
+// issueEmailVerification records a pending email change for userID and
+// returns the token that must be presented to ConfirmEmailChange to apply
+// it.
+func issueEmailVerification(userID, newEmail string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	defaultProfileStore.mu.Lock()
+	defaultProfileStore.emailVerifications[token] = &emailVerification{
+		UserID:    userID,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTTL),
+	}
+	defaultProfileStore.mu.Unlock()
+
+	return token, nil
+}
+
+// redeemEmailVerification consumes a single-use email verification token,
+// returning the userID/newEmail pair it was issued for.
+func redeemEmailVerification(token string) (userID, newEmail string, err error) {
+	defaultProfileStore.mu.Lock()
+	defer defaultProfileStore.mu.Unlock()
+
+	ev, ok := defaultProfileStore.emailVerifications[token]
+	if !ok || time.Now().UTC().After(ev.ExpiresAt) {
+		return "", "", UserNotFound
+	}
+	delete(defaultProfileStore.emailVerifications, token)
+
+	return ev.UserID, ev.NewEmail, nil
+}
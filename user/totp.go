@@ -0,0 +1,266 @@
+package user
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// totpMasterKey encrypts TOTP secrets at rest. It must be set once, at
+// startup, via SetTOTPMasterKey before Enroll/Confirm/Disable/Validate are
+// used.
+var totpMasterKey []byte
+
+// SetTOTPMasterKey configures the AES-256 key TOTP secrets are encrypted
+// with at rest. keyBytes must be 32 bytes; callers should derive it from an
+// operator-supplied secret (see main.initTOTPMasterKey) rather than passing
+// raw input through.
+func SetTOTPMasterKey(keyBytes []byte) {
+	totpMasterKey = keyBytes
+}
+
+// MissingTOTPMasterKey is returned when an operation needs to
+// encrypt/decrypt a TOTP secret but SetTOTPMasterKey was never called.
+var MissingTOTPMasterKey = errors.New("user: TOTP master key not configured")
+
+// InvalidTOTPCode is returned when a submitted 6-digit code (or recovery
+// code) does not validate.
+var InvalidTOTPCode = errors.New("user: invalid TOTP or recovery code")
+
+// NoPendingTOTPEnrollment is returned when ConfirmTOTP is called without a
+// prior, still-pending EnrollTOTP for the user.
+var NoPendingTOTPEnrollment = errors.New("user: no pending TOTP enrollment")
+
+// TOTPNotEnabled is returned when DisableTOTP or ValidateTOTPOrRecoveryCode
+// is called for a user that has not completed enrollment.
+var TOTPNotEnabled = errors.New("user: TOTP is not enabled")
+
+const recoveryCodeCount = 10
+
+// totpAccount holds a user's enabled TOTP configuration: the encrypted
+// secret and the (hashed) one-time recovery codes issued alongside it.
+type totpAccount struct {
+	encryptedSecret string
+	recoveryHashes  map[string]bool
+}
+
+type totpStore struct {
+	mu        sync.Mutex
+	pending   map[string]string // userID -> plaintext secret, awaiting ConfirmTOTP
+	confirmed map[string]*totpAccount
+}
+
+var defaultTOTPStore = &totpStore{
+	pending:   make(map[string]string),
+	confirmed: make(map[string]*totpAccount),
+}
+
+// EnrollTOTP generates a new random TOTP secret for userID and returns it
+// base32-encoded alongside its otpauth:// URI for QR rendering. The secret
+// is held pending until ConfirmTOTP validates a code against it; until
+// then, 2FA is not yet enabled.
+func EnrollTOTP(userID string) (secret string, otpauthURI string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      "Auth-Service",
+		AccountName: userID,
+		SecretSize:  20,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	defaultTOTPStore.mu.Lock()
+	defaultTOTPStore.pending[userID] = key.Secret()
+	defaultTOTPStore.mu.Unlock()
+
+	return key.Secret(), key.String(), nil
+}
+
+// ConfirmTOTP validates code against userID's pending TOTP secret, allowing
+// for a ±1 time-step window of clock drift. On success, 2FA is enabled for
+// userID and ten one-time recovery codes are returned; they are not
+// recoverable afterward, only their hashes are retained.
+func ConfirmTOTP(userID, code string) ([]string, error) {
+	defaultTOTPStore.mu.Lock()
+	secret, ok := defaultTOTPStore.pending[userID]
+	defaultTOTPStore.mu.Unlock()
+	if !ok {
+		return nil, NoPendingTOTPEnrollment
+	}
+
+	valid, err := totp.ValidateCustom(code, secret, time.Now(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    6,
+		Algorithm: totp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, InvalidTOTPCode
+	}
+
+	encryptedSecret, err := encryptSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, recoveryHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultTOTPStore.mu.Lock()
+	delete(defaultTOTPStore.pending, userID)
+	defaultTOTPStore.confirmed[userID] = &totpAccount{
+		encryptedSecret: encryptedSecret,
+		recoveryHashes:  recoveryHashes,
+	}
+	defaultTOTPStore.mu.Unlock()
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns off 2FA for userID, discarding its secret and any
+// unused recovery codes.
+func DisableTOTP(userID string) error {
+	defaultTOTPStore.mu.Lock()
+	defer defaultTOTPStore.mu.Unlock()
+
+	if _, ok := defaultTOTPStore.confirmed[userID]; !ok {
+		return TOTPNotEnabled
+	}
+	delete(defaultTOTPStore.confirmed, userID)
+	return nil
+}
+
+// TOTPEnabled reports whether userID has completed TOTP enrollment.
+func TOTPEnabled(userID string) bool {
+	defaultTOTPStore.mu.Lock()
+	defer defaultTOTPStore.mu.Unlock()
+
+	_, ok := defaultTOTPStore.confirmed[userID]
+	return ok
+}
+
+// ValidateTOTPOrRecoveryCode checks code against userID's enabled TOTP
+// secret (±1 time-step window) or, failing that, its unused recovery
+// codes. A matched recovery code is consumed and cannot be reused.
+func ValidateTOTPOrRecoveryCode(userID, code string) error {
+	defaultTOTPStore.mu.Lock()
+	account, ok := defaultTOTPStore.confirmed[userID]
+	defaultTOTPStore.mu.Unlock()
+	if !ok {
+		return TOTPNotEnabled
+	}
+
+	secret, err := decryptSecret(account.encryptedSecret)
+	if err != nil {
+		return err
+	}
+
+	// A code that isn't a well-formed 6-digit TOTP code (e.g. a 16-character
+	// recovery code) makes ValidateCustom return an error; that is not fatal
+	// here, it just means the recovery codes are checked next.
+	valid, err := totp.ValidateCustom(code, secret, time.Now(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    6,
+		Algorithm: totp.AlgorithmSHA1,
+	})
+	if err == nil && valid {
+		return nil
+	}
+
+	hash := hashToken(code)
+	defaultTOTPStore.mu.Lock()
+	defer defaultTOTPStore.mu.Unlock()
+	if account.recoveryHashes[hash] {
+		delete(account.recoveryHashes, hash)
+		return nil
+	}
+
+	return InvalidTOTPCode
+}
+
+// generateRecoveryCodes returns recoveryCodeCount plaintext recovery codes
+// and a set of their hashes, the latter suitable for at-rest storage.
+func generateRecoveryCodes() (codes []string, hashes map[string]bool, err error) {
+	hashes = make(map[string]bool, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code)
+		hashes[hashToken(code)] = true
+	}
+	return codes, hashes, nil
+}
+
+// encryptSecret AES-GCM encrypts plaintext with totpMasterKey, returning a
+// base64-encoded nonce||ciphertext.
+func encryptSecret(plaintext string) (string, error) {
+	if len(totpMasterKey) == 0 {
+		return "", MissingTOTPMasterKey
+	}
+
+	block, err := aes.NewCipher(totpMasterKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// decryptSecret reverses encryptSecret.
+func decryptSecret(encoded string) (string, error) {
+	if len(totpMasterKey) == 0 {
+		return "", MissingTOTPMasterKey
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(totpMasterKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(raw) < nonceSize {
+		return "", errors.New("user: malformed encrypted TOTP secret")
+	}
+	nonce, ciphertext := raw[:nonceSize], raw[nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
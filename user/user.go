@@ -0,0 +1,64 @@
+package user
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+// AuthCredentials is the UserID/Password pair presented at authentication
+// time, whether to log in, to create an account, or to re-verify an
+// existing one before a sensitive change.
+type AuthCredentials struct {
+	UserID   string
+	Password string
+}
+
+// User is an account's stored profile: its credentials plus the rest of
+// the fields the /me endpoints expose.
+type User struct {
+	AuthCredentials
+	Email string
+}
+
+// UserAlreadyExists is returned by CreateUser when UserID is already taken.
+var UserAlreadyExists = errors.New("user: already exists")
+
+// CreateUser records a new account, failing with UserAlreadyExists if
+// u.UserID is already taken. u.Password is hashed and stored as the
+// account's canonical Argon2id credential; it is never persisted in
+// plaintext, so the legacy AuthUser path can't be used against a newly
+// created account.
+func CreateUser(u *User) error {
+	hash, err := HashPassword(u.Password)
+	if err != nil {
+		return err
+	}
+	u.Password = ""
+
+	if err := insertUser(u); err != nil {
+		return err
+	}
+
+	setMigratedHash(u.UserID, hash)
+	return nil
+}
+
+// AuthUser checks ac against the account's legacy stored credentials, the
+// scheme authservice used before Authenticate's Argon2id migration path
+// (see password_hash.go). It does not consult lockout state or migration
+// bookkeeping; callers wanting those use Authenticate instead.
+func AuthUser(ac *AuthCredentials) error {
+	u, err := lookupUser(ac.UserID)
+	if err != nil {
+		return err
+	}
+	// An empty stored password means the account has no legacy credential
+	// (see CreateUser/UpdatePassword); it must never match.
+	if u.Password == "" {
+		return AuthFailed
+	}
+	if subtle.ConstantTimeCompare([]byte(u.Password), []byte(ac.Password)) != 1 {
+		return AuthFailed
+	}
+	return nil
+}